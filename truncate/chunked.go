@@ -0,0 +1,224 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// strategy selects how a deleter removes rows from a table.
+type strategy int
+
+const (
+	// StrategyPDML deletes rows with a single Partitioned DML statement.
+	// PDML applies at-least-once and can take a long time on huge tables,
+	// but requires no chunking.
+	StrategyPDML strategy = iota
+
+	// StrategyChunkedDML deletes rows in bounded-size batches, each inside
+	// its own read/write transaction, until a batch affects zero rows.
+	// This trades PDML's at-least-once semantics for per-chunk
+	// transactional guarantees, finer-grained progress, and avoids PDML's
+	// row-count/time limits on very large tables.
+	StrategyChunkedDML
+)
+
+const (
+	defaultChunkSize   = 10000
+	defaultParallelism = 1
+)
+
+// String returns a short, stable name for s, used in trace/log attributes.
+func (s strategy) String() string {
+	switch s {
+	case StrategyChunkedDML:
+		return "chunked_dml"
+	default:
+		return "pdml"
+	}
+}
+
+// chunkedDefaults returns o's ChunkSize/Parallelism with non-positive values
+// replaced by defaultChunkSize/defaultParallelism.
+func (o Options) chunkedDefaults() (chunkSize, parallelism int) {
+	chunkSize = o.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	parallelism = o.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+	return chunkSize, parallelism
+}
+
+// loadPrimaryKeyColumns fetches tableName's primary key column names, in key
+// order, from INFORMATION_SCHEMA and caches them on d. It is a no-op if the
+// columns are already cached.
+func (d *deleter) loadPrimaryKeyColumns(ctx context.Context) error {
+	if len(d.primaryKeyColumns) > 0 {
+		return nil
+	}
+
+	stmt := spanner.NewStatement(
+		"SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.INDEX_COLUMNS " +
+			"WHERE TABLE_NAME = @tableName AND INDEX_NAME = 'PRIMARY_KEY' " +
+			"ORDER BY ORDINAL_POSITION")
+	stmt.Params["tableName"] = d.tableName
+
+	var columns []string
+	if err := d.client.Single().Query(ctx, stmt).Do(func(r *spanner.Row) error {
+		var column string
+		if err := r.ColumnByName("COLUMN_NAME", &column); err != nil {
+			return err
+		}
+		columns = append(columns, column)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("truncate: loading primary key columns for table %q: %w", d.tableName, err)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("truncate: table %q has no primary key columns in INFORMATION_SCHEMA, cannot use StrategyChunkedDML", d.tableName)
+	}
+
+	d.primaryKeyColumns = columns
+	return nil
+}
+
+// deleteRowsChunked repeatedly deletes up to chunkSize rows at a time, running
+// parallelism chunk transactions concurrently, until a batch removes no rows.
+func (d *deleter) deleteRowsChunked(ctx context.Context) error {
+	if err := d.loadPrimaryKeyColumns(ctx); err != nil {
+		return err
+	}
+
+	chunkSize, parallelism := d.options.chunkedDefaults()
+
+	for {
+		rowsDeleted, err := d.deleteChunkBatch(ctx, chunkSize, parallelism)
+		if err != nil {
+			return err
+		}
+		if rowsDeleted == 0 {
+			return nil
+		}
+
+		remained := d.recordRowsDeleted(rowsDeleted)
+		d.observer().OnEvent(Progress{Table: d.tableName, RemainedRows: remained})
+	}
+}
+
+// deleteChunkBatch shards the table's primary key space into parallelism
+// disjoint slices and runs one chunk delete per shard concurrently, so
+// workers never race to delete the same rows. It returns the total number of
+// rows removed by the batch.
+func (d *deleter) deleteChunkBatch(ctx context.Context, chunkSize, parallelism int) (uint64, error) {
+	return runShards(parallelism, func(shard int) (uint64, error) {
+		return d.deleteChunk(ctx, chunkSize, shard, parallelism)
+	})
+}
+
+// runShards runs work once per shard index in [0, parallelism), concurrently,
+// and aggregates the results: the returned count is the sum of rows from
+// shards that succeeded, and the returned error is the first error observed
+// across shards (in completion order, which is not deterministic), with
+// later errors discarded.
+func runShards(parallelism int, work func(shard int) (uint64, error)) (uint64, error) {
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		firstErr  error
+		totalRows uint64
+	)
+
+	for shard := 0; shard < parallelism; shard++ {
+		shard := shard
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rows, err := work(shard)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			totalRows += rows
+		}()
+	}
+	wg.Wait()
+
+	return totalRows, firstErr
+}
+
+// deleteChunk deletes up to chunkSize rows matching whereClause whose primary
+// key falls into the given shard out of parallelism disjoint shards, inside a
+// single read/write transaction, and returns the number of rows deleted.
+//
+// Sharding by a hash of the primary key (rather than letting every worker run
+// the identical unordered LIMIT N query) ensures concurrent workers target
+// disjoint rows instead of colliding on the same first N rows.
+func (d *deleter) deleteChunk(ctx context.Context, chunkSize, shard, parallelism int) (uint64, error) {
+	pkColumns := strings.Join(d.primaryKeyColumns, ", ")
+	shardPredicate := shardPredicate(pkColumns, shard, parallelism)
+	rawStatement := fmt.Sprintf(
+		"DELETE FROM `%s` WHERE %s AND (%s) IN (SELECT %s FROM `%s` WHERE %s AND %s LIMIT %d)",
+		d.tableName, d.whereClause, pkColumns, pkColumns, d.tableName, d.whereClause, shardPredicate, chunkSize,
+	)
+	stmt := spanner.NewStatement(rawStatement)
+
+	var rowCount int64
+	_, err := d.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		n, err := txn.Update(ctx, stmt)
+		rowCount = n
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if rowCount > 0 {
+		d.instrumentation().rowsDeleted.Add(ctx, rowCount, metric.WithAttributes(attribute.String("table", d.tableName)))
+	}
+	return uint64(rowCount), nil
+}
+
+// shardPredicate returns a SQL predicate that's true for rows whose pkColumns
+// hash into the given shard out of parallelism disjoint shards.
+//
+// FARM_FINGERPRINT can return a negative INT64, and GoogleSQL's MOD takes the
+// sign of the dividend, so MOD(x, parallelism) alone can land in
+// (-parallelism, 0] instead of [0, parallelism) and never equal shard. Adding
+// parallelism before the second MOD normalizes the result back into
+// [0, parallelism).
+func shardPredicate(pkColumns string, shard, parallelism int) string {
+	return fmt.Sprintf(
+		"MOD(MOD(FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(%s))), %d) + %d, %d) = %d",
+		pkColumns, parallelism, parallelism, parallelism, shard,
+	)
+}
@@ -0,0 +1,117 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestShardPredicateFormat(t *testing.T) {
+	got := shardPredicate("pk", 2, 3)
+	want := "MOD(MOD(FARM_FINGERPRINT(TO_JSON_STRING(STRUCT(pk))), 3) + 3, 3) = 2"
+	if got != want {
+		t.Errorf("shardPredicate(%q, 2, 3) = %q, want %q", "pk", got, want)
+	}
+}
+
+// TestShardPredicateNormalizesNegativeFingerprint works through shard
+// assignment for a negative FARM_FINGERPRINT value (GoogleSQL's MOD, like
+// Go's %, takes the sign of the dividend). Plain MOD(-7, 3) is -1, which
+// matches no shard in [0, 3); shardPredicate's extra "+ parallelism, MOD"
+// normalizes it back into range instead of silently dropping the row.
+func TestShardPredicateNormalizesNegativeFingerprint(t *testing.T) {
+	const fingerprint, parallelism = int64(-7), 3
+	if plain := fingerprint % parallelism; plain == 0 || plain == 1 || plain == 2 {
+		t.Fatalf("fingerprint %% parallelism = %d, want it outside [0, %d) to exercise the bug", plain, parallelism)
+	}
+
+	const wantShard = 2 // -7 % 3 == -1; -1 + 3 == 2; 2 % 3 == 2.
+	normalized := (fingerprint%parallelism + parallelism) % parallelism
+	if normalized != wantShard {
+		t.Fatalf("normalized shard for fingerprint %d = %d, want %d", fingerprint, normalized, wantShard)
+	}
+}
+
+func TestOptionsChunkedDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            Options
+		wantChunkSize   int
+		wantParallelism int
+	}{
+		{"zero values", Options{}, defaultChunkSize, defaultParallelism},
+		{"negative values", Options{ChunkSize: -1, Parallelism: -1}, defaultChunkSize, defaultParallelism},
+		{"explicit values kept", Options{ChunkSize: 42, Parallelism: 7}, 42, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunkSize, parallelism := tt.opts.chunkedDefaults()
+			if chunkSize != tt.wantChunkSize || parallelism != tt.wantParallelism {
+				t.Errorf("%+v.chunkedDefaults() = (%d, %d), want (%d, %d)", tt.opts, chunkSize, parallelism, tt.wantChunkSize, tt.wantParallelism)
+			}
+		})
+	}
+}
+
+func TestRunShardsSumsRowsAcrossShards(t *testing.T) {
+	got, err := runShards(3, func(shard int) (uint64, error) {
+		return uint64(shard + 1), nil
+	})
+	if err != nil {
+		t.Fatalf("runShards() error = %v, want nil", err)
+	}
+	if want := uint64(1 + 2 + 3); got != want {
+		t.Errorf("runShards() = %d, want %d", got, want)
+	}
+}
+
+func TestRunShardsReturnsFirstErrorAndDropsFailedShardRows(t *testing.T) {
+	errA := errors.New("shard a failed")
+	errB := errors.New("shard b failed")
+
+	got, err := runShards(2, func(shard int) (uint64, error) {
+		if shard == 0 {
+			return 7, errA
+		}
+		return 9, errB
+	})
+	if err != errA && err != errB {
+		t.Fatalf("runShards() error = %v, want errA or errB", err)
+	}
+	if got != 0 {
+		t.Errorf("runShards() rows = %d, want 0 since every shard failed", got)
+	}
+}
+
+func TestRunShardsCountsOnlySucceedingShards(t *testing.T) {
+	boom := errors.New("boom")
+
+	got, err := runShards(4, func(shard int) (uint64, error) {
+		if shard%2 == 0 {
+			return 100, boom
+		}
+		return 5, nil
+	})
+	if err != boom {
+		t.Fatalf("runShards() error = %v, want %v", err, boom)
+	}
+	if want := uint64(5 * 2); got != want {
+		t.Errorf("runShards() rows = %d, want %d (only the two succeeding shards counted)", got, want)
+	}
+}
@@ -19,9 +19,14 @@ package truncate
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
 )
 
 // Status is a delete status.
@@ -42,7 +47,13 @@ type deleter struct {
 	tableName   string
 	whereClause string
 	client      *spanner.Client
-	status      status
+	options     Options
+
+	// mu guards status, remainedRows, inst, and startedAt, which are
+	// written both by the delete goroutine (deleteRows/deleteRowsChunked)
+	// and by the row-count updater goroutine (updateRowCount).
+	mu     sync.Mutex
+	status status
 
 	// Total rows in the table.
 	// Once set, we don't update this number even if new rows are added to the table.
@@ -50,29 +61,230 @@ type deleter struct {
 
 	// Remained rows in the table.
 	remainedRows uint64
+
+	// primaryKeyColumns lists the table's primary key column names, in key
+	// order. Only used by StrategyChunkedDML to scope each chunk.
+	primaryKeyColumns []string
+
+	// estimator sources the total/remaining row count for updateRowCount.
+	// Lazily initialized from options.RowCountMode.
+	estimator RowCountEstimator
+
+	// inst holds this deleter's tracer, meter, and metric instruments.
+	// Lazily initialized from options.TracerProvider/MeterProvider. Guarded
+	// by mu since instrumentation() can be called from either goroutine.
+	inst *instrumentation
+
+	// startedAt records when deleteRows first ran, for TableCompleted's
+	// Duration. Guarded by mu since it's written by deleteRows and read by
+	// updateRowCount.
+	startedAt time.Time
+
+	// lastCountAt and lastRemainedRows record the previous row-count tick,
+	// used to compute Progress.RowsPerSec.
+	lastCountAt      time.Time
+	lastRemainedRows uint64
+}
+
+// getStatus returns d's current status.
+func (d *deleter) getStatus() status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+// setStatus sets d's status.
+func (d *deleter) setStatus(s status) {
+	d.mu.Lock()
+	d.status = s
+	d.mu.Unlock()
+}
+
+// markStarted records startedAt as now, the first time it's called.
+func (d *deleter) markStarted() {
+	d.mu.Lock()
+	if d.startedAt.IsZero() {
+		d.startedAt = time.Now()
+	}
+	d.mu.Unlock()
+}
+
+// getStartedAt returns the startedAt time recorded by markStarted.
+func (d *deleter) getStartedAt() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.startedAt
 }
 
-// deleteRows deletes rows from the table using PDML.
+// transitionFromWaiting moves d to newStatus, unless d has already reached
+// statusCompleted, in which case it's a no-op and transitioned is false.
+// wasWaiting reports whether d was in statusWaiting immediately before the
+// transition, so the caller knows whether to undo the cascade_queue_depth +1
+// recorded when d entered statusWaiting.
+//
+// The read and write happen under one critical section rather than a
+// getStatus()/setStatus() pair, because parentDeletionStarted and
+// updateRowCount's count==0 tick can race on the same child: with separate
+// calls, both could observe wasWaiting=true before either writes (double-
+// decrementing cascade_queue_depth), and whichever writes last could clobber
+// the other's statusCompleted with statusCascadeDeleting, breaking
+// startRowCountUpdater's exit check.
+func (d *deleter) transitionFromWaiting(newStatus status) (wasWaiting, transitioned bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.status == statusCompleted {
+		return false, false
+	}
+	wasWaiting = d.status == statusWaiting
+	d.status = newStatus
+	return wasWaiting, true
+}
+
+// recordRowsDeleted subtracts rows from remainedRows and returns the new
+// value. It is safe to call concurrently with updateRowCount, which also
+// writes remainedRows from the periodic SELECT COUNT(*)/stats tick.
+func (d *deleter) recordRowsDeleted(rows uint64) uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rows >= d.remainedRows {
+		d.remainedRows = 0
+	} else {
+		d.remainedRows -= rows
+	}
+	return d.remainedRows
+}
+
+// deleteRows deletes rows from the table using the configured strategy.
 func (d *deleter) deleteRows(ctx context.Context) error {
-	d.status = statusDeleting
+	inst := d.instrumentation()
+	ctx, span := inst.tracer.Start(ctx, "truncate.deleteRows", trace.WithAttributes(
+		attribute.String("table", d.tableName),
+		attribute.String("where_clause_hash", whereClauseHash(d.whereClause)),
+		attribute.String("strategy", d.options.Strategy.String()),
+	))
+	defer span.End()
+
+	wasWaiting, transitioned := d.transitionFromWaiting(statusDeleting)
+	if !transitioned {
+		// d already reached statusCompleted concurrently (e.g. updateRowCount's
+		// count==0 tick ran just before our turn), so there's nothing left to
+		// delete. Bail out without clobbering statusCompleted back to
+		// statusDeleting.
+		return nil
+	}
+	if wasWaiting {
+		inst.queueDepth.Add(ctx, -1, metric.WithAttributes(attribute.String("table", d.tableName)))
+	}
+	d.markStarted()
+	d.observer().OnEvent(DeleteStarted{Table: d.tableName, Strategy: d.options.Strategy})
+
+	begin := time.Now()
+	var err error
+	switch d.options.Strategy {
+	case StrategyChunkedDML:
+		err = d.deleteRowsChunked(ctx)
+	default:
+		err = d.deleteRowsPDML(ctx)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	inst.pdmlDuration.Record(ctx, time.Since(begin).Seconds(), metric.WithAttributes(attribute.String("table", d.tableName)))
+	return nil
+}
+
+// deleteRowsPDML deletes rows from the table using PDML, retrying on
+// transient Spanner errors such as aborted transactions. PDML's
+// DELETE...WHERE is idempotent, so retrying is always safe.
+func (d *deleter) deleteRowsPDML(ctx context.Context) error {
 	rawStatement := fmt.Sprintf("DELETE FROM `%s` WHERE %s", d.tableName, d.whereClause)
 	stmt := spanner.NewStatement(rawStatement)
-	_, err := d.client.PartitionedUpdate(ctx, stmt)
+
+	retry := d.options.Retry.withDefaults()
+	if retry.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, retry.Deadline)
+		defer cancel()
+	}
+
+	span := trace.SpanFromContext(ctx)
+	backoff := retry.InitialBackoff
+	var err error
+	var rowCount int64
+	for attempt := 1; attempt <= retry.MaxAttempts; attempt++ {
+		rowCount, err = d.client.PartitionedUpdate(ctx, stmt)
+		if err == nil {
+			if rowCount > 0 {
+				d.instrumentation().rowsDeleted.Add(ctx, rowCount, metric.WithAttributes(attribute.String("table", d.tableName)))
+			}
+			return nil
+		}
+		if !isRetryablePDMLError(err) {
+			return err
+		}
+		if attempt == retry.MaxAttempts {
+			break
+		}
+
+		span.AddEvent("pdml_retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		d.instrumentation().retries.Add(ctx, 1, metric.WithAttributes(attribute.String("table", d.tableName)))
+		d.observer().OnEvent(PDMLRetry{Table: d.tableName, Attempt: attempt, Err: err})
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jitter(backoff)):
+		}
+
+		backoff *= 2
+		if backoff > retry.MaxBackoff {
+			backoff = retry.MaxBackoff
+		}
+	}
 	return err
 }
 
-// When parent deletion started, change child status unless the child deletion has already completed.
-func (d *deleter) parentDeletionStarted() {
-	if d.status != statusCompleted {
-		d.status = statusCascadeDeleting
+// isRetryablePDMLError reports whether err is a transient error that Spanner
+// may clear on its own, making a PDML retry worthwhile.
+func isRetryablePDMLError(err error) bool {
+	switch spanner.ErrCode(err) {
+	case codes.Aborted, codes.Unavailable, codes.Internal:
+		return true
+	default:
+		return false
 	}
 }
 
+// parentDeletionStarted notifies d that its parent table's delete has
+// started. It moves d into statusCascadeDeleting, unless d has already
+// completed, and notifies the observer so a CascadeStarted event is visible
+// for every child a parent's delete puts into that state.
+func (d *deleter) parentDeletionStarted(ctx context.Context, parent string, children []string) {
+	wasWaiting, transitioned := d.transitionFromWaiting(statusCascadeDeleting)
+	if !transitioned {
+		return
+	}
+	if wasWaiting {
+		// d is leaving statusWaiting without ever reaching deleteRows (the
+		// parent's cascade will remove its rows instead), so deleteRows
+		// never undoes the +1 recorded when it entered statusWaiting. Undo
+		// it here instead, the same way updateRowCount does when a table
+		// goes straight from statusWaiting to statusCompleted.
+		d.instrumentation().queueDepth.Add(ctx, -1, metric.WithAttributes(attribute.String("table", d.tableName)))
+	}
+	d.observer().OnEvent(CascadeStarted{Parent: parent, Children: children})
+}
+
 // startRowCountUpdater starts periodical row count in another goroutine.
 func (d *deleter) startRowCountUpdater(ctx context.Context) {
 	go func() {
 		for {
-			if d.status == statusCompleted {
+			if d.getStatus() == statusCompleted {
 				return
 			}
 
@@ -90,27 +302,65 @@ func (d *deleter) startRowCountUpdater(ctx context.Context) {
 }
 
 func (d *deleter) updateRowCount(ctx context.Context) error {
-	stmt := spanner.NewStatement(fmt.Sprintf("SELECT COUNT(*) as count FROM `%s` WHERE %s", d.tableName, d.whereClause))
-	var count int64
-
-	// Use stale read to minimize the impact on the leader replica.
-	txn := d.client.Single().WithTimestampBound(spanner.ExactStaleness(time.Second))
-	if err := txn.Query(ctx, stmt).Do(func(r *spanner.Row) error {
-		return r.ColumnByName("count", &count)
-	}); err != nil {
+	inst := d.instrumentation()
+	ctx, span := inst.tracer.Start(ctx, "truncate.updateRowCount", trace.WithAttributes(
+		attribute.String("table", d.tableName),
+	))
+	defer span.End()
+
+	if d.estimator == nil {
+		d.estimator = estimatorForMode(d.options.RowCountMode)
+	}
+
+	count, err := d.estimator.EstimateRowCount(ctx, d.client, d.tableName, d.whereClause)
+	if err != nil {
+		endSpan(span, err)
 		return err
 	}
+	span.SetAttributes(attribute.Int64("remained_rows", count))
 
 	if d.totalRows == 0 {
 		d.totalRows = uint64(count)
+		d.observer().OnEvent(TableAnalyzed{Table: d.tableName, TotalRows: d.totalRows})
+	}
+
+	now := time.Now()
+	var rowsPerSec float64
+	if !d.lastCountAt.IsZero() && d.lastRemainedRows > uint64(count) {
+		if elapsed := now.Sub(d.lastCountAt).Seconds(); elapsed > 0 {
+			rowsPerSec = float64(d.lastRemainedRows-uint64(count)) / elapsed
+		}
 	}
+	d.lastCountAt = now
+	d.lastRemainedRows = uint64(count)
+
+	d.mu.Lock()
 	d.remainedRows = uint64(count)
+	remained := d.remainedRows
+	d.mu.Unlock()
+	d.observer().OnEvent(Progress{Table: d.tableName, RemainedRows: remained, RowsPerSec: rowsPerSec})
 
 	if count == 0 {
-		d.status = statusCompleted
-	} else if d.status == statusAnalyzing {
-		d.status = statusWaiting
+		if wasWaiting, transitioned := d.transitionFromWaiting(statusCompleted); transitioned {
+			if wasWaiting {
+				// The table went straight from statusWaiting to
+				// statusCompleted without ever reaching deleteRows (e.g. it
+				// already had zero matching rows), so deleteRows never
+				// undid the +1 recorded below when it entered
+				// statusWaiting. Undo it here instead.
+				inst.queueDepth.Add(ctx, -1, metric.WithAttributes(attribute.String("table", d.tableName)))
+			}
+			d.observer().OnEvent(TableCompleted{
+				Table:       d.tableName,
+				Duration:    now.Sub(d.getStartedAt()),
+				RowsDeleted: d.totalRows,
+			})
+		}
+	} else if d.getStatus() == statusAnalyzing {
+		d.setStatus(statusWaiting)
+		inst.queueDepth.Add(ctx, 1, metric.WithAttributes(attribute.String("table", d.tableName)))
 	}
 
+	endSpan(span, nil)
 	return nil
 }
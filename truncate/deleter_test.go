@@ -0,0 +1,202 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+func TestIsRetryablePDMLError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"aborted", grpcstatus.Error(codes.Aborted, "aborted"), true},
+		{"unavailable", grpcstatus.Error(codes.Unavailable, "unavailable"), true},
+		{"internal", grpcstatus.Error(codes.Internal, "internal"), true},
+		{"invalid argument", grpcstatus.Error(codes.InvalidArgument, "bad where clause"), false},
+		{"not a grpc status", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryablePDMLError(tt.err); got != tt.want {
+				t.Errorf("isRetryablePDMLError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// queueDepthSum collects the current value of the cascade_queue_depth
+// instrument from reader.
+func queueDepthSum(t *testing.T, reader *metric.ManualReader) int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "spanner_truncate.cascade_queue_depth" {
+				continue
+			}
+			sum := m.Data.(metricdata.Sum[int64])
+			var total int64
+			for _, dp := range sum.DataPoints {
+				total += dp.Value
+			}
+			return total
+		}
+	}
+	return 0
+}
+
+func TestParentDeletionStartedDecrementsQueueDepthFromWaiting(t *testing.T) {
+	reader := metric.NewManualReader()
+	d := &deleter{
+		tableName: "child",
+		options:   Options{MeterProvider: metric.NewMeterProvider(metric.WithReader(reader))},
+	}
+	d.setStatus(statusWaiting)
+	d.instrumentation().queueDepth.Add(context.Background(), 1)
+
+	d.parentDeletionStarted(context.Background(), "parent", []string{"child"})
+
+	if got := d.getStatus(); got != statusCascadeDeleting {
+		t.Fatalf("status = %v, want statusCascadeDeleting", got)
+	}
+	if got := queueDepthSum(t, reader); got != 0 {
+		t.Fatalf("cascade_queue_depth = %d, want 0 (the +1 from entering statusWaiting undone by the cascade transition)", got)
+	}
+}
+
+func TestTransitionFromWaiting(t *testing.T) {
+	tests := []struct {
+		name             string
+		start            status
+		wantWasWaiting   bool
+		wantTransitioned bool
+	}{
+		{"from waiting", statusWaiting, true, true},
+		{"from deleting", statusDeleting, false, true},
+		{"from completed is a no-op", statusCompleted, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &deleter{}
+			d.setStatus(tt.start)
+
+			wasWaiting, transitioned := d.transitionFromWaiting(statusCascadeDeleting)
+			if wasWaiting != tt.wantWasWaiting || transitioned != tt.wantTransitioned {
+				t.Errorf("transitionFromWaiting() = (%v, %v), want (%v, %v)", wasWaiting, transitioned, tt.wantWasWaiting, tt.wantTransitioned)
+			}
+			if tt.start == statusCompleted {
+				if got := d.getStatus(); got != statusCompleted {
+					t.Errorf("status after no-op transition = %v, want unchanged statusCompleted", got)
+				}
+			}
+		})
+	}
+}
+
+// TestTransitionFromWaitingRaceOnlyOneSeesWasWaiting exercises the exact
+// scenario parentDeletionStarted and updateRowCount's count==0 tick can hit
+// concurrently on the same child: both racing a transition out of
+// statusWaiting. Only one should observe wasWaiting=true, so only one
+// cascade_queue_depth decrement ever fires.
+func TestTransitionFromWaitingRaceOnlyOneSeesWasWaiting(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		d := &deleter{}
+		d.setStatus(statusWaiting)
+
+		var wasWaiting [2]bool
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			wasWaiting[0], _ = d.transitionFromWaiting(statusCascadeDeleting)
+		}()
+		go func() {
+			defer wg.Done()
+			wasWaiting[1], _ = d.transitionFromWaiting(statusCompleted)
+		}()
+		wg.Wait()
+
+		if wasWaiting[0] == wasWaiting[1] {
+			t.Fatalf("iteration %d: both racers reported wasWaiting=%v, want exactly one true and one false", i, wasWaiting[0])
+		}
+	}
+}
+
+// TestDeleteRowsNeverClobbersCompletedFromConcurrentUpdateRowCount exercises
+// deleteRows racing transitionFromWaiting(statusCompleted) (the path
+// updateRowCount's count==0 tick takes) on the same deleter: if
+// updateRowCount wins, deleteRows must back off instead of unconditionally
+// overwriting statusCompleted with statusDeleting, which would make
+// startRowCountUpdater's exit check never trip.
+func TestDeleteRowsNeverClobbersCompletedFromConcurrentUpdateRowCount(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		d := &deleter{}
+		d.setStatus(statusWaiting)
+
+		var deletingTransitioned bool
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, deletingTransitioned = d.transitionFromWaiting(statusDeleting)
+		}()
+		go func() {
+			defer wg.Done()
+			d.transitionFromWaiting(statusCompleted)
+		}()
+		wg.Wait()
+
+		// If deleteRows's transition was rejected, it lost the race to
+		// updateRowCount's statusCompleted transition, so the final status
+		// must be statusCompleted, never reverted to statusDeleting.
+		if !deletingTransitioned && d.getStatus() != statusCompleted {
+			t.Fatalf("iteration %d: deleteRows transition was rejected but status = %v, want statusCompleted", i, d.getStatus())
+		}
+	}
+}
+
+func TestParentDeletionStartedLeavesQueueDepthAloneWhenNotWaiting(t *testing.T) {
+	reader := metric.NewManualReader()
+	d := &deleter{
+		tableName: "child",
+		options:   Options{MeterProvider: metric.NewMeterProvider(metric.WithReader(reader))},
+	}
+	d.setStatus(statusDeleting)
+
+	d.parentDeletionStarted(context.Background(), "parent", []string{"child"})
+
+	if got := queueDepthSum(t, reader); got != 0 {
+		t.Fatalf("cascade_queue_depth = %d, want 0 (d was never queued, so nothing to undo)", got)
+	}
+}
@@ -0,0 +1,114 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import "time"
+
+// Event is implemented by every event a deleter emits through an Observer.
+type Event interface {
+	isEvent()
+}
+
+// TableAnalyzed is emitted once a table's total row count has been
+// established.
+type TableAnalyzed struct {
+	Table     string
+	TotalRows uint64
+}
+
+func (TableAnalyzed) isEvent() {}
+
+// DeleteStarted is emitted when a deleter begins removing rows from a table.
+type DeleteStarted struct {
+	Table    string
+	Strategy strategy
+}
+
+func (DeleteStarted) isEvent() {}
+
+// Progress is emitted on every row-count tick, whatever the table's status,
+// and under StrategyChunkedDML also after every chunk batch that deletes rows.
+type Progress struct {
+	Table        string
+	RemainedRows uint64
+	RowsPerSec   float64
+}
+
+func (Progress) isEvent() {}
+
+// PDMLRetry is emitted each time a PartitionedUpdate call is retried after a
+// transient Spanner error.
+type PDMLRetry struct {
+	Table   string
+	Attempt int
+	Err     error
+}
+
+func (PDMLRetry) isEvent() {}
+
+// TableCompleted is emitted once a table's delete has finished, i.e. its row
+// count has reached zero.
+type TableCompleted struct {
+	Table       string
+	Duration    time.Duration
+	RowsDeleted uint64
+}
+
+func (TableCompleted) isEvent() {}
+
+// CascadeStarted is emitted by each child table once its parent's delete has
+// moved it into statusCascadeDeleting; a child that has already completed
+// emits nothing.
+type CascadeStarted struct {
+	Parent   string
+	Children []string
+}
+
+func (CascadeStarted) isEvent() {}
+
+// Observer receives events emitted while a truncate run progresses. It
+// replaces polling deleter.status/remainedRows directly, letting callers
+// embed spanner-truncate as a library (e.g. writing JSON progress to a log
+// sink, or driving a UI other than the bundled TUI).
+//
+// Implementations must be safe for concurrent use: events can be emitted
+// from the row-count updater goroutine concurrently with the goroutine
+// running deleteRows.
+type Observer interface {
+	OnEvent(Event)
+}
+
+// ObserverFunc adapts a function to an Observer.
+type ObserverFunc func(Event)
+
+// OnEvent implements Observer.
+func (f ObserverFunc) OnEvent(e Event) { f(e) }
+
+// noopObserver discards every event. It is the default when Options.Observer
+// is unset, so existing callers that poll status/remainedRows directly keep
+// working unchanged.
+type noopObserver struct{}
+
+func (noopObserver) OnEvent(Event) {}
+
+// observer returns d's configured Observer, or noopObserver if none was set.
+func (d *deleter) observer() Observer {
+	if d.options.Observer == nil {
+		return noopObserver{}
+	}
+	return d.options.Observer
+}
@@ -0,0 +1,111 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"math/rand"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = 500 * time.Millisecond
+	defaultMaxBackoff     = 32 * time.Second
+)
+
+// Options configures how a deleter performs and reports deletions.
+type Options struct {
+	// Retry controls how PDML calls are retried when Spanner aborts them.
+	Retry RetryOptions
+
+	// Strategy selects how rows are removed from the table. Zero value is
+	// StrategyPDML.
+	Strategy strategy
+
+	// ChunkSize is the number of rows deleted per chunk transaction under
+	// StrategyChunkedDML. Zero means defaultChunkSize.
+	ChunkSize int
+
+	// Parallelism is the number of chunk transactions run concurrently
+	// against a table under StrategyChunkedDML. Zero means
+	// defaultParallelism.
+	Parallelism int
+
+	// RowCountMode selects how total/remaining row counts are estimated.
+	// Zero value is RowCountModeExact.
+	RowCountMode RowCountMode
+
+	// TracerProvider supplies the tracer used to emit spans for this run.
+	// Nil uses the global TracerProvider, which is a no-op unless the
+	// caller has configured one via otel.SetTracerProvider.
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider supplies the meter used to emit metrics for this run.
+	// Nil uses the global MeterProvider, which is a no-op unless the
+	// caller has configured one via otel.SetMeterProvider.
+	MeterProvider metric.MeterProvider
+
+	// Observer receives typed progress events as the deleter runs. Nil
+	// discards all events, preserving the original status/remainedRows
+	// polling behavior.
+	Observer Observer
+}
+
+// RetryOptions configures retries for PartitionedUpdate calls that Spanner
+// aborts, typically due to concurrent schema changes or contention on large
+// tables.
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts, including the first,
+	// before giving up. Zero means defaultMaxAttempts.
+	MaxAttempts int
+
+	// InitialBackoff is the backoff duration used after the first retryable
+	// failure. Zero means defaultInitialBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the exponentially increasing backoff duration. Zero
+	// means defaultMaxBackoff.
+	MaxBackoff time.Duration
+
+	// Deadline bounds the total time spent retrying a single deleteRows
+	// call. Zero means no deadline beyond the caller's context.
+	Deadline time.Duration
+}
+
+// withDefaults returns a copy of r with zero fields replaced by defaults.
+func (r RetryOptions) withDefaults() RetryOptions {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = defaultMaxAttempts
+	}
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = defaultInitialBackoff
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = defaultMaxBackoff
+	}
+	return r
+}
+
+// jitter returns a random duration in [d/2, d], to avoid many deleters
+// retrying in lockstep.
+func jitter(d time.Duration) time.Duration {
+	delta := time.Duration(rand.Int63n(int64(d)/2 + 1))
+	return d/2 + delta
+}
@@ -0,0 +1,49 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryOptionsWithDefaults(t *testing.T) {
+	got := RetryOptions{}.withDefaults()
+	want := RetryOptions{
+		MaxAttempts:    defaultMaxAttempts,
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+	}
+	if got != want {
+		t.Errorf("RetryOptions{}.withDefaults() = %+v, want %+v", got, want)
+	}
+
+	custom := RetryOptions{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Minute, Deadline: time.Hour}
+	if got := custom.withDefaults(); got != custom {
+		t.Errorf("fully-populated RetryOptions.withDefaults() = %+v, want unchanged %+v", got, custom)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	const d = 10 * time.Second
+	for i := 0; i < 100; i++ {
+		got := jitter(d)
+		if got < d/2 || got > d {
+			t.Fatalf("jitter(%v) = %v, want in [%v, %v]", d, got, d/2, d)
+		}
+	}
+}
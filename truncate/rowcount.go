@@ -0,0 +1,174 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// RowCountMode selects how a deleter estimates total/remaining row counts.
+type RowCountMode int
+
+const (
+	// RowCountModeExact always runs SELECT COUNT(*), the original behavior.
+	// It is accurate but expensive on multi-billion-row tables.
+	RowCountModeExact RowCountMode = iota
+
+	// RowCountModeStats sources the estimate from
+	// SPANNER_SYS.TABLE_SIZES_STATS_1HOUR instead of COUNT(*), falling back
+	// to RowCountModeExact when the table isn't present in stats yet or
+	// when a whereClause is set.
+	RowCountModeStats
+
+	// RowCountModeHybrid uses stats for the initial estimate, for a fast
+	// startup on huge tables, then switches to COUNT(*) once the estimate
+	// drops below defaultHybridThreshold so the completion signal stays
+	// accurate.
+	RowCountModeHybrid
+)
+
+// ParseRowCountMode parses the --row-count-mode flag value.
+func ParseRowCountMode(s string) (RowCountMode, error) {
+	switch s {
+	case "", "exact":
+		return RowCountModeExact, nil
+	case "stats":
+		return RowCountModeStats, nil
+	case "hybrid":
+		return RowCountModeHybrid, nil
+	default:
+		return 0, fmt.Errorf("truncate: unknown row count mode %q", s)
+	}
+}
+
+const defaultHybridThreshold = 1000000
+
+// RowCountEstimator estimates the row count matching whereClause in tableName.
+type RowCountEstimator interface {
+	EstimateRowCount(ctx context.Context, client *spanner.Client, tableName, whereClause string) (int64, error)
+}
+
+// estimatorForMode returns the RowCountEstimator for RowCountMode m.
+func estimatorForMode(m RowCountMode) RowCountEstimator {
+	exact := &exactCountEstimator{}
+	switch m {
+	case RowCountModeStats:
+		return &statsTableEstimator{fallback: exact}
+	case RowCountModeHybrid:
+		return &hybridEstimator{
+			stats:     &statsTableEstimator{fallback: exact},
+			exact:     exact,
+			threshold: defaultHybridThreshold,
+		}
+	default:
+		return exact
+	}
+}
+
+// exactCountEstimator estimates the row count with SELECT COUNT(*), the
+// original, always-accurate behavior.
+type exactCountEstimator struct{}
+
+func (*exactCountEstimator) EstimateRowCount(ctx context.Context, client *spanner.Client, tableName, whereClause string) (int64, error) {
+	stmt := spanner.NewStatement(fmt.Sprintf("SELECT COUNT(*) as count FROM `%s` WHERE %s", tableName, whereClause))
+	var count int64
+
+	// Use stale read to minimize the impact on the leader replica.
+	txn := client.Single().WithTimestampBound(spanner.ExactStaleness(time.Second))
+	if err := txn.Query(ctx, stmt).Do(func(r *spanner.Row) error {
+		return r.ColumnByName("count", &count)
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// statsTableEstimator sources row counts from SPANNER_SYS.TABLE_SIZES_STATS_1HOUR,
+// which Spanner refreshes roughly hourly and is much cheaper to query than
+// COUNT(*) on huge tables. It falls back when the view has no row for the
+// table yet, or when whereClause filters rows the stats table can't account
+// for.
+type statsTableEstimator struct {
+	fallback RowCountEstimator
+
+	// warnedFallback ensures the fallback warning is logged at most once per
+	// estimator, instead of on every ~30s tick. Not safe for concurrent use,
+	// matching the rest of deleter's single-goroutine row-count updates.
+	warnedFallback bool
+}
+
+func (s *statsTableEstimator) EstimateRowCount(ctx context.Context, client *spanner.Client, tableName, whereClause string) (int64, error) {
+	if whereClause != "" && whereClause != "true" {
+		return s.fallback.EstimateRowCount(ctx, client, tableName, whereClause)
+	}
+
+	stmt := spanner.NewStatement(
+		"SELECT TOTAL_ROWS FROM SPANNER_SYS.TABLE_SIZES_STATS_1HOUR " +
+			"WHERE TABLE_NAME = @tableName ORDER BY INTERVAL_END DESC LIMIT 1")
+	stmt.Params["tableName"] = tableName
+
+	var count int64
+	found := false
+	err := client.Single().Query(ctx, stmt).Do(func(r *spanner.Row) error {
+		found = true
+		return r.ColumnByName("TOTAL_ROWS", &count)
+	})
+
+	if err == nil && found {
+		return count, nil
+	}
+
+	if !s.warnedFallback {
+		s.warnedFallback = true
+		if err != nil {
+			log.Printf("truncate: SPANNER_SYS.TABLE_SIZES_STATS_1HOUR query for table %q failed (%v), falling back to COUNT(*) for row-count estimation", tableName, err)
+		} else {
+			log.Printf("truncate: table %q not yet present in SPANNER_SYS.TABLE_SIZES_STATS_1HOUR, falling back to COUNT(*) for row-count estimation", tableName)
+		}
+	}
+	return s.fallback.EstimateRowCount(ctx, client, tableName, whereClause)
+}
+
+// hybridEstimator starts from stats for a fast initial estimate on huge
+// tables, then permanently switches to the exact COUNT(*) estimator once the
+// stats-reported count drops below threshold, so the completion signal
+// (remainedRows reaching zero) stays accurate.
+type hybridEstimator struct {
+	stats     RowCountEstimator
+	exact     RowCountEstimator
+	threshold int64
+	switched  bool
+}
+
+func (h *hybridEstimator) EstimateRowCount(ctx context.Context, client *spanner.Client, tableName, whereClause string) (int64, error) {
+	if !h.switched {
+		count, err := h.stats.EstimateRowCount(ctx, client, tableName, whereClause)
+		if err != nil {
+			return 0, err
+		}
+		if count >= h.threshold {
+			return count, nil
+		}
+		h.switched = true
+	}
+	return h.exact.EstimateRowCount(ctx, client, tableName, whereClause)
+}
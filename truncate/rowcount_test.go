@@ -0,0 +1,103 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestParseRowCountMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RowCountMode
+		wantErr bool
+	}{
+		{"", RowCountModeExact, false},
+		{"exact", RowCountModeExact, false},
+		{"stats", RowCountModeStats, false},
+		{"hybrid", RowCountModeHybrid, false},
+		{"bogus", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRowCountMode(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRowCountMode(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseRowCountMode(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// fakeEstimator returns a fixed sequence of counts, in order, ignoring its
+// arguments.
+type fakeEstimator struct {
+	counts []int64
+	calls  int
+}
+
+func (f *fakeEstimator) EstimateRowCount(ctx context.Context, client *spanner.Client, tableName, whereClause string) (int64, error) {
+	count := f.counts[f.calls]
+	f.calls++
+	return count, nil
+}
+
+func TestHybridEstimatorSwitchesToExactBelowThreshold(t *testing.T) {
+	stats := &fakeEstimator{counts: []int64{5000, 500, 500}}
+	exact := &fakeEstimator{counts: []int64{400, 0}}
+	h := &hybridEstimator{stats: stats, exact: exact, threshold: 1000}
+
+	ctx := context.Background()
+
+	// Above threshold: stays on stats.
+	count, err := h.EstimateRowCount(ctx, nil, "t", "true")
+	if err != nil || count != 5000 {
+		t.Fatalf("first EstimateRowCount = %d, %v, want 5000, nil", count, err)
+	}
+	if stats.calls != 1 || exact.calls != 0 {
+		t.Fatalf("expected only stats to be queried while above threshold, got stats.calls=%d exact.calls=%d", stats.calls, exact.calls)
+	}
+
+	// Drops below threshold: switches to exact permanently.
+	count, err = h.EstimateRowCount(ctx, nil, "t", "true")
+	if err != nil || count != 400 {
+		t.Fatalf("second EstimateRowCount = %d, %v, want 400, nil", count, err)
+	}
+	if !h.switched {
+		t.Fatal("expected hybridEstimator to have switched to the exact estimator")
+	}
+
+	// Stays on exact even if a subsequent call would otherwise re-check stats.
+	count, err = h.EstimateRowCount(ctx, nil, "t", "true")
+	if err != nil || count != 0 {
+		t.Fatalf("third EstimateRowCount = %d, %v, want 0, nil", count, err)
+	}
+	// stats is also queried on the switch-over call itself (that query is
+	// how the estimator learns the count dropped below threshold), so it
+	// ends up at 2 calls rather than 1.
+	if stats.calls != 2 {
+		t.Fatalf("expected stats to be queried twice (once before the switch, once on it), got %d calls", stats.calls)
+	}
+	if exact.calls != 2 {
+		t.Fatalf("expected exact to be queried twice after switching, got %d calls", exact.calls)
+	}
+}
@@ -0,0 +1,114 @@
+//
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package truncate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies this package's tracer and meter to
+// exporters.
+const instrumentationName = "github.com/sevincit/spanner-truncate/truncate"
+
+// instrumentation holds the tracer, meter, and metric instruments used to
+// observe a single truncate run.
+type instrumentation struct {
+	tracer trace.Tracer
+
+	rowsDeleted  metric.Int64Counter
+	pdmlDuration metric.Float64Histogram
+	retries      metric.Int64Counter
+	queueDepth   metric.Int64UpDownCounter
+}
+
+// newInstrumentation builds an instrumentation from opts' TracerProvider and
+// MeterProvider, falling back to the global providers (no-ops unless the
+// caller has configured otel.SetTracerProvider / otel.SetMeterProvider) when
+// unset.
+func newInstrumentation(opts Options) *instrumentation {
+	tp := opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	mp := opts.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+
+	rowsDeleted, _ := meter.Int64Counter(
+		"spanner_truncate.rows_deleted",
+		metric.WithDescription("Rows deleted, per table."),
+	)
+	pdmlDuration, _ := meter.Float64Histogram(
+		"spanner_truncate.delete_duration_seconds",
+		metric.WithDescription("Wall-clock duration of a table's delete, per table."),
+	)
+	retries, _ := meter.Int64Counter(
+		"spanner_truncate.pdml_retries",
+		metric.WithDescription("PDML retry attempts, per table."),
+	)
+	queueDepth, _ := meter.Int64UpDownCounter(
+		"spanner_truncate.cascade_queue_depth",
+		metric.WithDescription("Tables currently waiting for their dependent tables to be deleted."),
+	)
+
+	return &instrumentation{
+		tracer:       tp.Tracer(instrumentationName),
+		rowsDeleted:  rowsDeleted,
+		pdmlDuration: pdmlDuration,
+		retries:      retries,
+		queueDepth:   queueDepth,
+	}
+}
+
+// instrumentation lazily builds d's instrumentation from its Options. It's
+// guarded by d.mu since it's called from both the delete goroutine and the
+// row-count updater goroutine.
+func (d *deleter) instrumentation() *instrumentation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.inst == nil {
+		d.inst = newInstrumentation(d.options)
+	}
+	return d.inst
+}
+
+// endSpan records err's status on span using the OpenTelemetry error status
+// code, not just the error message, so trace backends can filter on it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		return
+	}
+	span.SetStatus(otelcodes.Ok, "")
+}
+
+// whereClauseHash returns a short, stable hash of whereClause for span
+// attributes. Hashing avoids putting potentially sensitive predicate values
+// into trace backends while still letting identical clauses be correlated.
+func whereClauseHash(whereClause string) string {
+	sum := sha256.Sum256([]byte(whereClause))
+	return hex.EncodeToString(sum[:8])
+}